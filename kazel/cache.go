@@ -0,0 +1,100 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// kazelCacheFileName is the name of the cache file findGeneratorTags
+// persists at the walk root to avoid re-scanning unchanged files.
+const kazelCacheFileName = ".kazel-cache"
+
+// rawTagOccurrence is a single "+k8s:tag=value" comment found in a file,
+// independent of requestedTags or K8sCodegenTagSchema: it's recomputed only
+// when the file's bytes change, and re-filtered against the live config on
+// every read (see filterTags), so caching it can never serve a stale
+// newly-requested tag or skip re-validating against a changed schema.
+type rawTagOccurrence struct {
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+	Line  int    `json:"line"`
+}
+
+// kazelCacheEntry records the raw tag occurrences found in a single file,
+// keyed by its path, mtime and size so a changed file is never served from
+// cache.
+type kazelCacheEntry struct {
+	ModTime     int64              `json:"modTime"`
+	Size        int64              `json:"size"`
+	Occurrences []rawTagOccurrence `json:"occurrences"`
+}
+
+// kazelCache maps file path to its cached kazelCacheEntry.
+type kazelCache map[string]kazelCacheEntry
+
+// loadKazelCache reads the cache file at root/.kazel-cache. A missing file
+// is not an error; it just means every file will be scanned fresh.
+func loadKazelCache(root string) (kazelCache, error) {
+	b, err := ioutil.ReadFile(filepath.Join(root, kazelCacheFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(kazelCache), nil
+		}
+		return nil, err
+	}
+	cache := make(kazelCache)
+	if err := json.Unmarshal(b, &cache); err != nil {
+		// A corrupt cache shouldn't fail the run; just rescan everything.
+		return make(kazelCache), nil
+	}
+	return cache, nil
+}
+
+// saveKazelCache writes cache to root/.kazel-cache.
+func saveKazelCache(root string, cache kazelCache) error {
+	b, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(root, kazelCacheFileName), b, 0644)
+}
+
+// lookup returns the cached raw tag occurrences for path if its size and
+// mtime still match what was recorded.
+func (c kazelCache) lookup(path string, info os.FileInfo) ([]rawTagOccurrence, bool) {
+	entry, ok := c[path]
+	if !ok {
+		return nil, false
+	}
+	if entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		return nil, false
+	}
+	return entry.Occurrences, true
+}
+
+// store records the raw tag occurrences found in path.
+func (c kazelCache) store(path string, info os.FileInfo, occurrences []rawTagOccurrence) {
+	c[path] = kazelCacheEntry{
+		ModTime:     info.ModTime().UnixNano(),
+		Size:        info.Size(),
+		Occurrences: occurrences,
+	}
+}
@@ -0,0 +1,304 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// codegenOrder is the dependency order generators must run in: a later
+// generator's input may depend on an earlier generator's output (e.g.
+// clientset generation reads the deepcopy/defaulter tags on the types it
+// wraps).
+var codegenOrder = []string{
+	"deepcopy-gen",
+	"defaulter-gen",
+	"conversion-gen",
+	"openapi-gen",
+	"client-gen",
+	"informer-gen",
+	"lister-gen",
+}
+
+// GeneratorRunConfig describes how to invoke a single code generator binary
+// for the packages kazel discovered via findGeneratorTags.
+type GeneratorRunConfig struct {
+	// Binary is the path (or PATH-resolved name) of the generator to exec.
+	Binary string `yaml:"binary"`
+	// Tag is the +k8s: tag that marks a package as needing this generator,
+	// e.g. "deepcopy-gen" for "+k8s:deepcopy-gen=true".
+	Tag string `yaml:"tag"`
+	// OutputBase is the bare generator-name suffix used to build the
+	// zz_generated file name for each input package, e.g. "deepcopy" for
+	// "zz_generated.deepcopy.go". Passed to the generator binary as
+	// "zz_generated.<OutputBase>" via --output-file-base.
+	OutputBase string `yaml:"outputBase"`
+	// ExtraArgs are appended to the generator's invocation after the input
+	// dirs, boilerplate and output-base flags kazel fills in automatically.
+	ExtraArgs []string `yaml:"extraArgs"`
+}
+
+// runGenerators invokes the configured k8s code generators, in codegenOrder,
+// over the packages discovered in tagsValuesPkgs. Generators sharing a
+// codegenOrder slot with no configuration are skipped. Each generator's
+// input packages are run concurrently with a small worker pool; if
+// v.dryRun is set, runGenerators only reports which zz_generated files
+// would change rather than invoking the binaries.
+func (v *Vendorer) runGenerators(tagsValuesPkgs generatorTagsValuesPkgsMap) (bool, error) {
+	if len(v.cfg.K8sCodegenRunGenerators) == 0 {
+		return false, nil
+	}
+
+	anyChanged := false
+	for _, tag := range codegenOrder {
+		genCfg, configured := v.cfg.K8sCodegenRunGenerators[tag]
+		if !configured {
+			continue
+		}
+		pkgs := pkgsForTag(tagsValuesPkgs, genCfg.Tag)
+		if len(pkgs) == 0 {
+			continue
+		}
+		changed, err := v.runGenerator(genCfg, pkgs)
+		if err != nil {
+			return anyChanged, fmt.Errorf("running %s: %v", tag, err)
+		}
+		anyChanged = anyChanged || changed
+	}
+	return anyChanged, nil
+}
+
+// pkgsForTag flattens every value recorded for tag into a single sorted set
+// of input package directories.
+func pkgsForTag(tagsValuesPkgs generatorTagsValuesPkgsMap, tag string) []string {
+	byValue, ok := tagsValuesPkgs[tag]
+	if !ok {
+		return nil
+	}
+	pkgSet := make(map[string]bool)
+	for _, pkgs := range byValue {
+		for pkg := range pkgs {
+			pkgSet[pkg] = true
+		}
+	}
+	pkgs := make([]string, 0, len(pkgSet))
+	for pkg := range pkgSet {
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs
+}
+
+// runGenerator runs a single generator binary across pkgs with a worker pool
+// sized to GOMAXPROCS-equivalent concurrency, returning whether any package's
+// output changed (in dry-run mode, whether it would change).
+func (v *Vendorer) runGenerator(genCfg GeneratorRunConfig, pkgs []string) (bool, error) {
+	workers := runtime.GOMAXPROCS(0)
+	if workers < 1 {
+		workers = 1
+	}
+	pkgCh := make(chan string)
+	errCh := make(chan error, len(pkgs))
+	var changedCount int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pkg := range pkgCh {
+				changed, err := v.execGenerator(genCfg, pkg)
+				if err != nil {
+					errCh <- fmt.Errorf("%s: %v", pkg, err)
+					continue
+				}
+				if changed {
+					atomic.AddInt32(&changedCount, 1)
+				}
+			}
+		}()
+	}
+	for _, pkg := range pkgs {
+		pkgCh <- pkg
+	}
+	close(pkgCh)
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		return changedCount > 0, err
+	}
+	return changedCount > 0, nil
+}
+
+// importPathForPkg converts pkg — a filesystem-relative package directory,
+// as produced by filepath.Dir in findGeneratorTags — into the Go import
+// path gengo generators require for --input-dirs; they resolve that flag
+// as an import path, not a filesystem path, so passing pkg directly (as a
+// bare relative dir) fails to locate the package.
+func importPathForPkg(goPrefix, pkg string) string {
+	if pkg == "." {
+		return goPrefix
+	}
+	return goPrefix + "/" + filepath.ToSlash(pkg)
+}
+
+// gengoOutputBase returns the directory a gengo generator's --output-base
+// flag must point at so that filepath.Join(outputBase, importPath)
+// resolves back to a package's real location under root: gengo generators
+// write (or, pointed at a scratch directory, can be diffed against)
+// outputBase/importPath/outputFileBase.go, so this is what lets
+// execGenerator target the real zz_generated file rather than some
+// GOPATH-relative copy of it.
+func gengoOutputBase(root, goPrefix string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	suffix := filepath.FromSlash(goPrefix)
+	if !strings.HasSuffix(absRoot, suffix) {
+		return "", fmt.Errorf("repo root %q does not end in GoPrefix %q; cannot compute generator --output-base", absRoot, goPrefix)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(absRoot, suffix), string(filepath.Separator)), nil
+}
+
+// execGenerator runs genCfg.Binary for a single input package, unless
+// needsRegen finds the existing zz_generated file already newer than every
+// source file in pkg, in which case it short-circuits without invoking the
+// binary at all. Otherwise it runs the generator for real and diffs the
+// file's contents before and after to determine whether anything actually
+// changed. In dry-run mode, since gengo generators have no stdout-emitting
+// dry-run mode of their own, it instead points --output-base at a scratch
+// directory and diffs the file the generator writes there against the real
+// zz_generated file, leaving the tree untouched.
+func (v *Vendorer) execGenerator(genCfg GeneratorRunConfig, pkg string) (bool, error) {
+	outFile := fmt.Sprintf("%s/zz_generated.%s.go", pkg, genCfg.OutputBase)
+
+	regen, err := needsRegen(pkg, outFile)
+	if err != nil {
+		return false, err
+	}
+	if !regen {
+		return false, nil
+	}
+
+	importPath := importPathForPkg(v.cfg.GoPrefix, pkg)
+	outputFileBase := "zz_generated." + genCfg.OutputBase
+
+	before, err := ioutil.ReadFile(outFile)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if !v.dryRun {
+		outputBase, err := gengoOutputBase(".", v.cfg.GoPrefix)
+		if err != nil {
+			return false, err
+		}
+		args := append([]string{
+			"--input-dirs", importPath,
+			"--output-base", outputBase,
+			"--output-file-base", outputFileBase,
+		}, genCfg.ExtraArgs...)
+		if v.cfg.K8sCodegenBoilerplateFile != "" {
+			args = append(args, "--go-header-file", v.cfg.K8sCodegenBoilerplateFile)
+		}
+		cmd := exec.Command(genCfg.Binary, args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return false, err
+		}
+		after, err := ioutil.ReadFile(outFile)
+		if err != nil {
+			return false, err
+		}
+		return !bytes.Equal(before, after), nil
+	}
+
+	tmpDir, err := ioutil.TempDir("", "kazel-gengo-dryrun")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	args := append([]string{
+		"--input-dirs", importPath,
+		"--output-base", tmpDir,
+		"--output-file-base", outputFileBase,
+	}, genCfg.ExtraArgs...)
+	if v.cfg.K8sCodegenBoilerplateFile != "" {
+		args = append(args, "--go-header-file", v.cfg.K8sCodegenBoilerplateFile)
+	}
+	cmd := exec.Command(genCfg.Binary, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return false, err
+	}
+
+	after, err := ioutil.ReadFile(filepath.Join(tmpDir, filepath.FromSlash(importPath), outputFileBase+".go"))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	changed := !bytes.Equal(before, after)
+	if changed {
+		fmt.Fprintf(os.Stderr, "would regenerate %s\n", outFile)
+	}
+	return changed, nil
+}
+
+// needsRegen reports whether outFile is missing or older than any non-test
+// .go source file in pkg, i.e. whether its generator should actually run.
+// This is the "short-circuit when source files are unchanged since the last
+// zz_generated.*.go" optimization: regenerating is comparatively expensive,
+// so skip it whenever the existing output is already up to date.
+func needsRegen(pkg, outFile string) (bool, error) {
+	outInfo, err := os.Stat(outFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	entries, err := ioutil.ReadDir(pkg)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if name == filepath.Base(outFile) {
+			continue
+		}
+		if entry.ModTime().After(outInfo.ModTime()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -17,14 +17,16 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strings"
-
-	"github.com/bazelbuild/buildtools/build"
+	"sync"
 )
 
 var (
@@ -35,71 +37,203 @@ var (
 // {tagName: {value: {pkgs}}}
 type generatorTagsValuesPkgsMap map[string]map[string]map[string]bool
 
-// extractTags finds k8s codegen tags found in b listed in requestedTags.
-// It returns a map of {tag name: slice of values for that tag}.
-func extractTags(b []byte, requestedTags map[string]bool) map[string][]string {
-	tags := make(map[string][]string)
-	matches := genTagRe.FindAllSubmatch(b, -1)
+// scanTags finds every k8s codegen tag occurrence in b, regardless of
+// requestedTags or schema — it's a pure function of the file's bytes, which
+// is what makes it safe to cache: the result never goes stale as
+// K8sCodegenTags or K8sCodegenTagSchema change.
+func scanTags(b []byte) []rawTagOccurrence {
+	var occurrences []rawTagOccurrence
+	matches := genTagRe.FindAllSubmatchIndex(b, -1)
 	for _, m := range matches {
-		if len(m) >= 3 {
-			tag, values := string(m[1]), string(m[2])
-			if _, requested := requestedTags[tag]; !requested {
-				continue
+		if len(m) < 6 {
+			continue
+		}
+		line := 1 + bytes.Count(b[:m[0]], []byte("\n"))
+		occurrences = append(occurrences, rawTagOccurrence{
+			Tag:   string(b[m[2]:m[3]]),
+			Value: string(b[m[4]:m[5]]),
+			Line:  line,
+		})
+	}
+	return occurrences
+}
+
+// filterTags narrows occurrences down to the tags listed in requestedTags,
+// splitting and validating each value against schemas (tags with no
+// configured schema are accepted as-is). Unlike scanTags, this depends on
+// the current K8sCodegenTags/K8sCodegenTagSchema config, so it must be
+// re-run on every call — including for occurrences served from the
+// .kazel-cache file — rather than cached itself.
+func filterTags(occurrences []rawTagOccurrence, requestedTags map[string]bool, schemas map[string]tagSchema, root, file string) (map[string][]string, tagValueErrors) {
+	tags := make(map[string][]string)
+	var errs tagValueErrors
+	for _, occ := range occurrences {
+		if _, requested := requestedTags[occ.Tag]; !requested {
+			continue
+		}
+
+		if schemas[occ.Tag].Kind == tagKindCSVEnum || schemas[occ.Tag].Kind == "" {
+			for _, v := range strings.Split(occ.Value, ",") {
+				if reason := validateTagValue(schemas, root, occ.Tag, v); reason != "" {
+					errs = append(errs, tagValueError{File: file, Line: occ.Line, Tag: occ.Tag, Value: v, Reason: reason})
+					continue
+				}
+				tags[occ.Tag] = append(tags[occ.Tag], v)
 			}
-			tags[tag] = append(tags[tag], strings.Split(values, ",")...)
+			continue
+		}
+
+		if reason := validateTagValue(schemas, root, occ.Tag, occ.Value); reason != "" {
+			errs = append(errs, tagValueError{File: file, Line: occ.Line, Tag: occ.Tag, Value: occ.Value, Reason: reason})
+			continue
 		}
+		tags[occ.Tag] = append(tags[occ.Tag], occ.Value)
 	}
-	return tags
+	return tags, errs
+}
+
+// extractTags finds k8s codegen tags found in b listed in requestedTags.
+// It returns a map of {tag name: slice of values for that tag}, plus any
+// tagValueErrors produced by validating values against schemas. file and
+// root are only used to annotate errors.
+func extractTags(b []byte, requestedTags map[string]bool, schemas map[string]tagSchema, root, file string) (map[string][]string, tagValueErrors) {
+	return filterTags(scanTags(b), requestedTags, schemas, root, file)
+}
+
+// generatorTagFile is a single file's scan result, passed from a worker to
+// the collector goroutine in findGeneratorTags.
+type generatorTagFile struct {
+	pkg  string
+	tags map[string][]string
+	errs tagValueErrors
 }
 
 // findGeneratorTags searches for all packages under root that include a kubernetes generator
 // tag comment. It does not follow symlinks, and any path in the configured skippedPaths
-// or codegen skipped paths is skipped.
-func (v *Vendorer) findGeneratorTags(root string, requestedTags map[string]bool) (generatorTagsValuesPkgsMap, error) {
-	tagsValuesPkgs := make(generatorTagsValuesPkgsMap)
+// or codegen skipped paths is skipped. Tag values are validated against
+// v.cfg.K8sCodegenTagSchema; any invalid values are aggregated into the
+// returned tagValueErrors rather than silently accepted.
+//
+// Scanning is pipelined: a producer goroutine walks the tree and pushes
+// candidate file paths onto a buffered channel, a pool of GOMAXPROCS
+// workers reads and regex-scans each file, and this goroutine collects the
+// partial results into tagsValuesPkgs. Files unchanged since the last run
+// (same path, size and mtime) are served from the .kazel-cache file at root
+// instead of being re-read and re-scanned.
+func (v *Vendorer) findGeneratorTags(root string, requestedTags map[string]bool) (generatorTagsValuesPkgsMap, tagValueErrors, error) {
+	cache, err := loadKazelCache(root)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	walkErr := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		pkg := filepath.Dir(path)
+	paths := make(chan string, 256)
+	results := make(chan generatorTagFile, 256)
+	walkErrCh := make(chan error, 1)
 
-		for _, r := range v.skippedK8sCodegenPaths {
-			if r.MatchString(pkg) {
-				return filepath.SkipDir
+	go func() {
+		defer close(paths)
+		walkErrCh <- filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			pkg := filepath.Dir(path)
+
+			for _, r := range v.skippedK8sCodegenPaths {
+				if r.MatchString(pkg) {
+					return filepath.SkipDir
+				}
 			}
-		}
 
-		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+				return nil
+			}
+			paths <- path
 			return nil
-		}
+		})
+	}()
 
-		b, err := ioutil.ReadFile(path)
-		if err != nil {
-			return err
-		}
+	workers := runtime.GOMAXPROCS(0)
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	var cacheMu sync.Mutex
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				info, err := os.Stat(path)
+				if err != nil {
+					results <- generatorTagFile{errs: tagValueErrors{{File: path, Reason: err.Error()}}}
+					continue
+				}
 
-		for tag, values := range extractTags(b, requestedTags) {
+				cacheMu.Lock()
+				occurrences, hit := cache.lookup(path, info)
+				cacheMu.Unlock()
+				if !hit {
+					b, err := ioutil.ReadFile(path)
+					if err != nil {
+						results <- generatorTagFile{errs: tagValueErrors{{File: path, Reason: err.Error()}}}
+						continue
+					}
+					occurrences = scanTags(b)
+					cacheMu.Lock()
+					cache.store(path, info, occurrences)
+					cacheMu.Unlock()
+				}
+
+				// Filtering and schema validation always run against the
+				// current config, cache hit or not, so a newly requested
+				// tag or a changed schema is never masked by a stale entry.
+				tags, errs := filterTags(occurrences, requestedTags, v.cfg.K8sCodegenTagSchema, root, path)
+				results <- generatorTagFile{pkg: filepath.Dir(path), tags: tags, errs: errs}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	tagsValuesPkgs := make(generatorTagsValuesPkgsMap)
+	var allErrs tagValueErrors
+	for res := range results {
+		allErrs = append(allErrs, res.errs...)
+		for tag, values := range res.tags {
 			if _, present := tagsValuesPkgs[tag]; !present {
 				tagsValuesPkgs[tag] = make(map[string]map[string]bool)
 			}
-			for _, v := range values {
-				if _, present := tagsValuesPkgs[tag][v]; !present {
-					tagsValuesPkgs[tag][v] = make(map[string]bool)
+			for _, val := range values {
+				if _, present := tagsValuesPkgs[tag][val]; !present {
+					tagsValuesPkgs[tag][val] = make(map[string]bool)
 				}
 				// Since multiple files in the same package may list a given tag/value, use a set to deduplicate.
-				tagsValuesPkgs[tag][v][pkg] = true
+				tagsValuesPkgs[tag][val][res.pkg] = true
 			}
 		}
+	}
 
-		return nil
-	})
+	if walkErr := <-walkErrCh; walkErr != nil {
+		return nil, nil, walkErr
+	}
 
-	if walkErr != nil {
-		return nil, walkErr
+	// A dry run must not mutate the tree, so leave the cache file untouched.
+	if !v.dryRun {
+		if err := saveKazelCache(root, cache); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return tagsValuesPkgs, nil
+	sort.Slice(allErrs, func(i, j int) bool {
+		if allErrs[i].File != allErrs[j].File {
+			return allErrs[i].File < allErrs[j].File
+		}
+		return allErrs[i].Line < allErrs[j].Line
+	})
+
+	return tagsValuesPkgs, allErrs, nil
 }
 
 // flattened returns a copy of the map with the final stringSet flattened into a sorted slice.
@@ -124,7 +258,19 @@ func flattened(m generatorTagsValuesPkgsMap) map[string]map[string][]string {
 // included.
 // If a K8sCodegenBoilerplateFile was configured, the contents of this file
 // will be included as the header of the generated bzl file.
-// Returns true if there are diffs against the existing generated bzl file.
+// If K8sCodegenRunGenerators is configured, the matching generator binaries
+// are invoked directly (via runGenerators) for the discovered packages,
+// ahead of the Bazel-consumed bzl file being written.
+// If K8sCodegenZZPrefixes is configured, stale zz_generated files left
+// behind by a removed tag are pruned (via walkGeneratedPrune) before the
+// bzl file is written.
+// If K8sCodegenJSONFile and/or K8sCodegenYAMLFile are configured, the same
+// {tag: {value: [pkgs]}} data is additionally written in those formats, via
+// codegenManifest, for non-Bazel consumers.
+// Returns true if there are diffs against the existing generated bzl file,
+// or if any stale zz_generated file was (or, in dry-run, would be) pruned —
+// the same signal callers use to gate CI on a clean dry-run, mirroring
+// walkImportRestrictions.
 func (v *Vendorer) walkGenerated() (bool, error) {
 	if v.cfg.K8sCodegenBzlFile == "" {
 		return false, nil
@@ -134,24 +280,47 @@ func (v *Vendorer) walkGenerated() (bool, error) {
 	for _, tag := range v.cfg.K8sCodegenTags {
 		requestedTags[tag] = true
 	}
-	tagsValuesPkgs, err := v.findGeneratorTags(".", requestedTags)
+	tagsValuesPkgs, tagErrs, err := v.findGeneratorTags(".", requestedTags)
+	if err != nil {
+		return false, err
+	}
+	if len(tagErrs) > 0 {
+		return false, tagErrs
+	}
+
+	generatorsChanged, err := v.runGenerators(tagsValuesPkgs)
 	if err != nil {
 		return false, err
 	}
+	if generatorsChanged {
+		fmt.Fprintln(os.Stderr, "k8s code generators produced changes; re-run tests/builds that depend on their output")
+	}
 
-	f := &build.File{
-		Path: v.cfg.K8sCodegenBzlFile,
+	prunedChanged := false
+	if len(v.cfg.K8sCodegenZZPrefixes) > 0 {
+		pruned, err := v.walkGeneratedPrune(".", tagsValuesPkgs, requestedTags)
+		if err != nil {
+			return false, err
+		}
+		if len(pruned) > 0 {
+			verb := "pruned"
+			if v.dryRun {
+				verb = "would prune"
+			}
+			fmt.Fprintf(os.Stderr, "%s %d stale zz_generated file(s):\n", verb, len(pruned))
+			for _, path := range pruned {
+				fmt.Fprintf(os.Stderr, "  %s\n", path)
+			}
+			prunedChanged = true
+		}
 	}
-	addCommentBefore(f, "#################################################")
-	addCommentBefore(f, "# # # # # # # # # # # # # # # # # # # # # # # # #")
-	addCommentBefore(f, "This file is autogenerated by kazel. DO NOT EDIT.")
-	addCommentBefore(f, "# # # # # # # # # # # # # # # # # # # # # # # # #")
-	addCommentBefore(f, "#################################################")
-	addCommentBefore(f, "")
 
-	f.Stmt = append(f.Stmt, varExpr("go_prefix", "The go prefix passed to kazel", v.cfg.GoPrefix))
-	f.Stmt = append(f.Stmt, varExpr("kazel_configured_tags", "The list of codegen tags kazel is configured to find", v.cfg.K8sCodegenTags))
-	f.Stmt = append(f.Stmt, varExpr("tags_values_pkgs", "tags_values_pkgs is a dictionary mapping {k8s build tag: {tag value: [pkgs including that tag:value]}}", flattened(tagsValuesPkgs)))
+	manifest := &codegenManifest{
+		GoPrefix:       v.cfg.GoPrefix,
+		ConfiguredTags: v.cfg.K8sCodegenTags,
+		TagsValuesPkgs: flattened(tagsValuesPkgs),
+		TagSchemas:     v.cfg.K8sCodegenTagSchema,
+	}
 
 	var boilerplate []byte
 	if v.cfg.K8sCodegenBoilerplateFile != "" {
@@ -160,10 +329,16 @@ func (v *Vendorer) walkGenerated() (bool, error) {
 			return false, err
 		}
 	}
-	// Open existing file to use in diff mode.
-	_, err = os.Stat(f.Path)
-	if err != nil && !os.IsNotExist(err) {
+
+	if _, err := manifest.WriteJSON(v.cfg.K8sCodegenJSONFile, v.dryRun); err != nil {
+		return false, err
+	}
+	if _, err := manifest.WriteYAML(v.cfg.K8sCodegenYAMLFile, v.dryRun); err != nil {
+		return false, err
+	}
+	bzlChanged, err := manifest.WriteBzl(v.cfg.K8sCodegenBzlFile, boilerplate, v.dryRun)
+	if err != nil {
 		return false, err
 	}
-	return writeFile(f.Path, f, boilerplate, !os.IsNotExist(err), v.dryRun)
+	return bzlChanged || prunedChanged, nil
 }
@@ -0,0 +1,257 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bazelbuild/buildtools/build"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	importRestrictionsFileName     = ".import-restrictions"
+	importRestrictionsFileNameYAML = ".import-restrictions.yaml"
+)
+
+// importRestrictionRule mirrors the upstream Kubernetes .import-restrictions
+// format: imports whose path matches SelectorRegexp must additionally match
+// one of AllowedPrefixes (if any are given) and none of ForbiddenPrefixes.
+type importRestrictionRule struct {
+	SelectorRegexp    string   `yaml:"selectorRegexp"`
+	AllowedPrefixes   []string `yaml:"allowedPrefixes"`
+	ForbiddenPrefixes []string `yaml:"forbiddenPrefixes"`
+
+	compiled *regexp.Regexp
+}
+
+type importRestrictions struct {
+	Rules []importRestrictionRule `yaml:"rules"`
+}
+
+// importViolation records a single disallowed import found while walking the
+// tree, with enough context to report it like a compiler error.
+type importViolation struct {
+	File   string
+	Line   int
+	Import string
+	Reason string
+}
+
+func (iv importViolation) String() string {
+	return fmt.Sprintf("%s:%d: import %q %s", iv.File, iv.Line, iv.Import, iv.Reason)
+}
+
+// loadImportRestrictions reads and compiles the .import-restrictions (or
+// .import-restrictions.yaml) file in dir, if any. It returns nil, nil if
+// neither file is present.
+func loadImportRestrictions(dir string) (*importRestrictions, error) {
+	for _, name := range []string{importRestrictionsFileName, importRestrictionsFileNameYAML} {
+		path := filepath.Join(dir, name)
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		var ir importRestrictions
+		if err := yaml.Unmarshal(b, &ir); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", path, err)
+		}
+		for i := range ir.Rules {
+			re, err := regexp.Compile(ir.Rules[i].SelectorRegexp)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid selectorRegexp %q: %v", path, ir.Rules[i].SelectorRegexp, err)
+			}
+			ir.Rules[i].compiled = re
+		}
+		return &ir, nil
+	}
+	return nil, nil
+}
+
+// walkImportRestrictions walks the tree from root, validating every
+// package's imports against the nearest ancestor .import-restrictions file
+// (a package inherits its parent's rules unless it defines its own, mirroring
+// how cmd/kubeadm/.import-restrictions and pkg/controller/.import-restrictions
+// are used upstream). When v.cfg.K8sImportRestrictionsBzlFile is set, the
+// per-package rule sets are additionally written out as a bzl dictionary for
+// a go_import_check Starlark rule to consume; otherwise the imports are
+// validated directly and any violations are returned.
+func (v *Vendorer) walkImportRestrictions(root string) ([]importViolation, error) {
+	var violations []importViolation
+	rulesByDir := make(map[string]*importRestrictions)
+	pkgRules := make(map[string]*importRestrictions)
+
+	walkErr := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		for _, r := range v.skippedK8sCodegenPaths {
+			if r.MatchString(path) {
+				return filepath.SkipDir
+			}
+		}
+
+		ir, err := loadImportRestrictions(path)
+		if err != nil {
+			return err
+		}
+		if ir != nil {
+			rulesByDir[path] = ir
+		}
+		pkgRules[path] = nearestImportRestrictions(path, rulesByDir)
+		return nil
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	if v.cfg.K8sImportRestrictionsBzlFile != "" {
+		return nil, v.writeImportRestrictionsBzl(pkgRules)
+	}
+
+	for pkg, rules := range pkgRules {
+		if rules == nil {
+			continue
+		}
+		pkgViolations, err := validatePackageImports(pkg, rules)
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, pkgViolations...)
+	}
+	return violations, nil
+}
+
+// nearestImportRestrictions walks up from dir looking for the closest
+// ancestor (inclusive) that defined its own rules.
+func nearestImportRestrictions(dir string, rulesByDir map[string]*importRestrictions) *importRestrictions {
+	for d := dir; ; {
+		if ir, ok := rulesByDir[d]; ok {
+			return ir
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return nil
+		}
+		d = parent
+	}
+}
+
+// validatePackageImports parses every non-test .go file in pkg and checks
+// its imports against rules, returning file:line-annotated violations.
+func validatePackageImports(pkg string, rules *importRestrictions) ([]importViolation, error) {
+	var violations []importViolation
+	entries, err := ioutil.ReadDir(pkg)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		path := filepath.Join(pkg, name)
+		f, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+		for _, imp := range f.Imports {
+			importPath := strings.Trim(imp.Path.Value, `"`)
+			if reason, ok := forbiddenImport(importPath, rules); ok {
+				violations = append(violations, importViolation{
+					File:   path,
+					Line:   fset.Position(imp.Pos()).Line,
+					Import: importPath,
+					Reason: reason,
+				})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// forbiddenImport evaluates importPath against rules, returning a
+// human-readable reason if it's disallowed.
+func forbiddenImport(importPath string, rules *importRestrictions) (string, bool) {
+	for _, rule := range rules.Rules {
+		if !rule.compiled.MatchString(importPath) {
+			continue
+		}
+		for _, forbidden := range rule.ForbiddenPrefixes {
+			if strings.HasPrefix(importPath, forbidden) {
+				return fmt.Sprintf("matches forbidden prefix %q", forbidden), true
+			}
+		}
+		if len(rule.AllowedPrefixes) == 0 {
+			continue
+		}
+		for _, allowed := range rule.AllowedPrefixes {
+			if strings.HasPrefix(importPath, allowed) {
+				return "", false
+			}
+		}
+		return "does not match any allowed prefix", true
+	}
+	return "", false
+}
+
+// writeImportRestrictionsBzl emits a package -> rule set dictionary to
+// v.cfg.K8sImportRestrictionsBzlFile for a Starlark go_import_check rule.
+func (v *Vendorer) writeImportRestrictionsBzl(pkgRules map[string]*importRestrictions) error {
+	f := &build.File{
+		Path: v.cfg.K8sImportRestrictionsBzlFile,
+	}
+	addCommentBefore(f, "This file is autogenerated by kazel. DO NOT EDIT.")
+
+	rulesByPkg := make(map[string][]map[string]interface{})
+	for pkg, rules := range pkgRules {
+		if rules == nil {
+			continue
+		}
+		var ruleDicts []map[string]interface{}
+		for _, r := range rules.Rules {
+			ruleDicts = append(ruleDicts, map[string]interface{}{
+				"selector_regexp":    r.SelectorRegexp,
+				"allowed_prefixes":   r.AllowedPrefixes,
+				"forbidden_prefixes": r.ForbiddenPrefixes,
+			})
+		}
+		rulesByPkg[pkg] = ruleDicts
+	}
+	f.Stmt = append(f.Stmt, varExpr("import_restrictions", "import_restrictions maps {pkg: [rule dicts]} for go_import_check", rulesByPkg))
+
+	_, err := os.Stat(f.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	_, err = writeFile(f.Path, f, nil, !os.IsNotExist(err), v.dryRun)
+	return err
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestForbiddenImport(t *testing.T) {
+	rules := &importRestrictions{
+		Rules: []importRestrictionRule{
+			{
+				SelectorRegexp:    `k8s\.io/repo-infra/pkg/.*`,
+				AllowedPrefixes:   []string{"k8s.io/repo-infra/pkg/util"},
+				ForbiddenPrefixes: []string{"k8s.io/repo-infra/pkg/internal"},
+			},
+		},
+	}
+	rules.Rules[0].compiled = regexp.MustCompile(rules.Rules[0].SelectorRegexp)
+
+	cases := []struct {
+		name       string
+		importPath string
+		wantBad    bool
+	}{
+		{"unrelated import untouched by selector", "fmt", false},
+		{"matches allowed prefix", "k8s.io/repo-infra/pkg/util/foo", false},
+		{"matches forbidden prefix", "k8s.io/repo-infra/pkg/internal/foo", true},
+		{"matches selector but no allowed prefix", "k8s.io/repo-infra/pkg/other", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, bad := forbiddenImport(c.importPath, rules)
+			if bad != c.wantBad {
+				t.Errorf("forbiddenImport(%q) bad = %v, want %v", c.importPath, bad, c.wantBad)
+			}
+		})
+	}
+}
+
+func TestValidatePackageImports(t *testing.T) {
+	root, err := ioutil.TempDir("", "kazel-imports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	pkg := filepath.Join(root, "pkg", "consumer")
+	if err := os.MkdirAll(pkg, 0755); err != nil {
+		t.Fatal(err)
+	}
+	src := `package consumer
+
+import (
+	"fmt"
+
+	"k8s.io/repo-infra/pkg/internal/secret"
+)
+
+var _ = fmt.Sprintf
+var _ = secret.Value
+`
+	if err := ioutil.WriteFile(filepath.Join(pkg, "consumer.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := &importRestrictions{
+		Rules: []importRestrictionRule{
+			{
+				SelectorRegexp:    `k8s\.io/repo-infra/pkg/.*`,
+				ForbiddenPrefixes: []string{"k8s.io/repo-infra/pkg/internal"},
+			},
+		},
+	}
+	rules.Rules[0].compiled = regexp.MustCompile(rules.Rules[0].SelectorRegexp)
+
+	violations, err := validatePackageImports(pkg, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 1 {
+		t.Fatalf("violations = %v, want exactly 1", violations)
+	}
+	if violations[0].Import != "k8s.io/repo-infra/pkg/internal/secret" {
+		t.Errorf("violations[0].Import = %q, want the forbidden import", violations[0].Import)
+	}
+}
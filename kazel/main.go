@@ -0,0 +1,83 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+var (
+	root         = flag.String("root", ".", "root of the tree to walk")
+	cfgPath      = flag.String("cfg-path", "kazel.json", "path to a kazel JSON config file, relative to --root")
+	dryRunFlag   = flag.Bool("dry-run", false, "print diffs instead of writing files")
+	checkImports = flag.Bool("check-imports", false, "validate .import-restrictions files under --root and exit non-zero on any violation, instead of running the normal codegen walk")
+)
+
+func main() {
+	flag.Parse()
+
+	b, err := ioutil.ReadFile(*cfgPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reading %s: %v\n", *cfgPath, err)
+		os.Exit(1)
+	}
+	cfg := &Config{}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "parsing %s: %v\n", *cfgPath, err)
+		os.Exit(1)
+	}
+
+	v := &Vendorer{cfg: cfg, dryRun: *dryRunFlag}
+
+	if *checkImports {
+		os.Exit(runCheckImports(v, *root))
+	}
+
+	changed, err := v.walkGenerated()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if v.dryRun && changed {
+		fmt.Fprintln(os.Stderr, "dry run found pending codegen changes")
+		os.Exit(1)
+	}
+}
+
+// runCheckImports backs the --check-imports flag: it validates every
+// package's imports under root against the nearest .import-restrictions
+// file and prints any violations. It returns the process exit code: 0 if
+// there were no violations, 1 on a violation or an error running the walk.
+func runCheckImports(v *Vendorer, root string) int {
+	violations, err := v.walkImportRestrictions(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	for _, violation := range violations {
+		fmt.Fprintln(os.Stderr, violation.String())
+	}
+	if len(violations) > 0 {
+		fmt.Fprintf(os.Stderr, "%d import-restriction violation(s) found\n", len(violations))
+		return 1
+	}
+	return 0
+}
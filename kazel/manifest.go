@@ -0,0 +1,141 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/bazelbuild/buildtools/build"
+	"gopkg.in/yaml.v2"
+)
+
+// autogeneratedBanner is the human-readable warning kazel prepends to every
+// manifest format it emits.
+const autogeneratedBanner = "This file is autogenerated by kazel. DO NOT EDIT."
+
+// codegenManifest is the single in-memory representation of the k8s codegen
+// tag data kazel discovers, shared by every output format walkGenerated can
+// produce (bzl, JSON, YAML) so there is one source of truth for the data
+// model.
+type codegenManifest struct {
+	GoPrefix       string
+	ConfiguredTags []string
+	TagsValuesPkgs map[string]map[string][]string
+	TagSchemas     map[string]tagSchema
+}
+
+// WriteBzl writes the manifest as a Starlark-consumable .bzl file, matching
+// the format historically emitted directly from walkGenerated. Returns true
+// if there are diffs against the existing file.
+func (m *codegenManifest) WriteBzl(path string, boilerplate []byte, dryRun bool) (bool, error) {
+	if path == "" {
+		return false, nil
+	}
+	f := &build.File{Path: path}
+	addCommentBefore(f, "#################################################")
+	addCommentBefore(f, "# # # # # # # # # # # # # # # # # # # # # # # # #")
+	addCommentBefore(f, autogeneratedBanner)
+	addCommentBefore(f, "# # # # # # # # # # # # # # # # # # # # # # # # #")
+	addCommentBefore(f, "#################################################")
+	addCommentBefore(f, "")
+
+	f.Stmt = append(f.Stmt, varExpr("go_prefix", "The go prefix passed to kazel", m.GoPrefix))
+	f.Stmt = append(f.Stmt, varExpr("kazel_configured_tags", "The list of codegen tags kazel is configured to find", m.ConfiguredTags))
+	f.Stmt = append(f.Stmt, varExpr("tags_values_pkgs", "tags_values_pkgs is a dictionary mapping {k8s build tag: {tag value: [pkgs including that tag:value]}}", m.TagsValuesPkgs))
+	f.Stmt = append(f.Stmt, varExpr("tag_schemas", "tag_schemas maps {k8s build tag: {kind: ..., enum_values: [...]}} so Starlark rules can reason about value types", flattenedSchemas(m.TagSchemas)))
+
+	_, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return writeFile(path, f, boilerplate, !os.IsNotExist(err), dryRun)
+}
+
+// manifestDocument is the plain-data shape shared by WriteJSON and WriteYAML;
+// field order here is also the key order emitted in the JSON object (Go's
+// json package additionally sorts any nested map[string]X keys, giving a
+// fully stable, diffable output).
+type manifestDocument struct {
+	GoPrefix            string                            `json:"go_prefix" yaml:"go_prefix"`
+	KazelConfiguredTags []string                          `json:"kazel_configured_tags" yaml:"kazel_configured_tags"`
+	TagsValuesPkgs      map[string]map[string][]string    `json:"tags_values_pkgs" yaml:"tags_values_pkgs"`
+	TagSchemas          map[string]map[string]interface{} `json:"tag_schemas" yaml:"tag_schemas"`
+}
+
+func (m *codegenManifest) document() manifestDocument {
+	return manifestDocument{
+		GoPrefix:            m.GoPrefix,
+		KazelConfiguredTags: m.ConfiguredTags,
+		TagsValuesPkgs:      m.TagsValuesPkgs,
+		TagSchemas:          flattenedSchemas(m.TagSchemas),
+	}
+}
+
+// WriteJSON writes the manifest as a JSON file with the same autogenerated
+// banner (as a top-level "_comment" field, JSON having no native comment
+// syntax) and the same diff/dry-run semantics as WriteBzl.
+func (m *codegenManifest) WriteJSON(path string, dryRun bool) (bool, error) {
+	if path == "" {
+		return false, nil
+	}
+	doc := struct {
+		Comment string `json:"_comment"`
+		manifestDocument
+	}{Comment: autogeneratedBanner, manifestDocument: m.document()}
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	b = append(b, '\n')
+	return writeManifestFile(path, b, dryRun)
+}
+
+// WriteYAML writes the manifest as a YAML file, with the autogenerated
+// banner as a leading "#" comment, and the same diff/dry-run semantics as
+// WriteBzl. Key order is stable across runs because every map here is
+// nested under the fixed fields of manifestDocument, and gopkg.in/yaml.v2
+// sorts a map's keys when marshaling it — there's no reliance on Go's
+// randomized map iteration order.
+func (m *codegenManifest) WriteYAML(path string, dryRun bool) (bool, error) {
+	if path == "" {
+		return false, nil
+	}
+	body, err := yaml.Marshal(m.document())
+	if err != nil {
+		return false, err
+	}
+	b := append([]byte("# "+autogeneratedBanner+"\n"), body...)
+	return writeManifestFile(path, b, dryRun)
+}
+
+// writeManifestFile compares b against the existing contents of path (if
+// any) and, unless dryRun is set, writes it out. Returns true if the
+// contents differ from what's on disk.
+func writeManifestFile(path string, b []byte, dryRun bool) (bool, error) {
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	changed := string(existing) != string(b)
+	if !changed || dryRun {
+		return changed, nil
+	}
+	return changed, ioutil.WriteFile(path, b, 0644)
+}
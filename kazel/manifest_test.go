@@ -0,0 +1,129 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testManifest() *codegenManifest {
+	return &codegenManifest{
+		GoPrefix:       "k8s.io/repo-infra",
+		ConfiguredTags: []string{"deepcopy-gen", "client-gen"},
+		TagsValuesPkgs: map[string]map[string][]string{
+			"deepcopy-gen": {"true": {"pkg/b", "pkg/a"}},
+		},
+		TagSchemas: map[string]tagSchema{
+			"client-gen": {Kind: tagKindEnum, EnumValues: []string{"register"}},
+		},
+	}
+}
+
+func TestWriteJSONStableKeyOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kazel-manifest-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "codegen.json")
+
+	m := testManifest()
+	for i := 0; i < 5; i++ {
+		if _, err := m.WriteJSON(path, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(got, []byte(`"_comment": "`+autogeneratedBanner+`"`)) {
+		t.Errorf("output missing autogenerated banner comment:\n%s", got)
+	}
+	if !strings.Contains(string(got), `"go_prefix": "k8s.io/repo-infra"`) {
+		t.Errorf("output missing go_prefix field:\n%s", got)
+	}
+
+	// Re-run against the same manifest and confirm byte-for-byte repeated
+	// output, since map key order (Go's json package sorts map keys) is
+	// what keeps this diffable across runs.
+	again, err := m.WriteJSON(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again {
+		t.Errorf("WriteJSON reported changed against its own unchanged output")
+	}
+}
+
+func TestWriteJSONDryRunDoesNotWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kazel-manifest-json-dry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "codegen.json")
+
+	changed, err := testManifest().WriteJSON(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Errorf("WriteJSON dry-run against a missing file reported unchanged")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("dry-run wrote %s", path)
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kazel-manifest-yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "codegen.yaml")
+
+	if _, err := testManifest().WriteYAML(path, false); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(got, []byte("# "+autogeneratedBanner+"\n")) {
+		t.Errorf("output missing leading banner comment:\n%s", got)
+	}
+	if !strings.Contains(string(got), "go_prefix: k8s.io/repo-infra") {
+		t.Errorf("output missing go_prefix field:\n%s", got)
+	}
+
+	changed, err := testManifest().WriteYAML(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Errorf("WriteYAML reported changed against its own unchanged output")
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// walkGeneratedPrune removes zz_generated.<name>.go files sitting in
+// packages that no longer carry the corresponding +k8s:<name>=... tag.
+// This closes the gap where removing a tag from a package leaves behind a
+// zz_generated file that still compiles and masks the deletion.
+//
+// tagsValuesPkgs and requestedTags are the results of (and input to) the
+// findGeneratorTags call for the same walk; v.cfg.K8sCodegenZZPrefixes
+// lists the generator name suffixes to consider (e.g. "deepcopy",
+// "defaulter", "conversion"), matching the "zz_generated.<suffix>.go" file
+// each one produces. A suffix's authorizing tag is "<suffix>-gen" (e.g.
+// "deepcopy" is authorized by "+k8s:deepcopy-gen=..."), matching the
+// upstream kubernetes generator naming convention. In dry-run mode, nothing
+// is deleted and the paths that would be pruned are only printed. Returns
+// the sorted list of paths pruned (or that would be pruned, in dry-run
+// mode).
+//
+// A prefix whose authorizing tag was never requested (absent from
+// requestedTags, e.g. dropped from K8sCodegenTags without a matching
+// K8sCodegenZZPrefixes update) is skipped entirely rather than treated as
+// "no packages have this tag" — findGeneratorTags never scanned for it, so
+// pkgsForTag would otherwise return an empty set and every
+// zz_generated.<suffix>.go in the tree would look orphaned and be deleted.
+func (v *Vendorer) walkGeneratedPrune(root string, tagsValuesPkgs generatorTagsValuesPkgsMap, requestedTags map[string]bool) ([]string, error) {
+	var pruned []string
+
+	for _, zzName := range v.cfg.K8sCodegenZZPrefixes {
+		tag := zzName + "-gen"
+		if !requestedTags[tag] {
+			fmt.Fprintf(os.Stderr, "skipping prune of zz_generated.%s.go: %q is not in K8sCodegenTags, so it was never scanned\n", zzName, tag)
+			continue
+		}
+		taggedPkgs := pkgsForTag(tagsValuesPkgs, tag)
+		taggedPkgSet := make(map[string]bool, len(taggedPkgs))
+		for _, pkg := range taggedPkgs {
+			taggedPkgSet[pkg] = true
+		}
+
+		zzFileName := fmt.Sprintf("zz_generated.%s.go", zzName)
+		walkErr := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			pkg := filepath.Dir(path)
+
+			for _, r := range v.skippedK8sCodegenPaths {
+				if r.MatchString(pkg) {
+					return filepath.SkipDir
+				}
+			}
+
+			if info.IsDir() || filepath.Base(path) != zzFileName {
+				return nil
+			}
+			if taggedPkgSet[pkg] {
+				return nil
+			}
+
+			if v.dryRun {
+				fmt.Fprintf(os.Stderr, "would prune %s (no +k8s:%s tag in %s)\n", path, tag, pkg)
+			} else if err := os.Remove(path); err != nil {
+				return err
+			}
+			pruned = append(pruned, path)
+			return nil
+		})
+		if walkErr != nil {
+			return nil, walkErr
+		}
+	}
+
+	sort.Strings(pruned)
+	return pruned, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeZZFile(t *testing.T, root, pkg, name string) {
+	t.Helper()
+	dir := filepath.Join(root, pkg)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("package pkg\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWalkGeneratedPrune(t *testing.T) {
+	root, err := ioutil.TempDir("", "kazel-prune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeZZFile(t, root, "pkg/tagged", "zz_generated.deepcopy.go")
+	writeZZFile(t, root, "pkg/orphaned", "zz_generated.deepcopy.go")
+	writeZZFile(t, root, "pkg/untouched", "zz_generated.defaulter.go")
+
+	v := &Vendorer{cfg: &Config{K8sCodegenZZPrefixes: []string{"deepcopy", "defaulter"}}}
+	// walkGeneratedPrune derives each file's pkg via filepath.Dir(path) over
+	// a walk rooted at the root argument below, so the pkgs recorded in
+	// tagsValuesPkgs must be root-prefixed to match, exactly as
+	// findGeneratorTags' real output would be.
+	tagsValuesPkgs := generatorTagsValuesPkgsMap{
+		"deepcopy-gen": {"true": {filepath.Join(root, "pkg/tagged"): true}},
+	}
+	// "defaulter-gen" is deliberately absent from requestedTags below, as if
+	// it had been dropped from K8sCodegenTags without updating
+	// K8sCodegenZZPrefixes to match.
+	requestedTags := map[string]bool{"deepcopy-gen": true}
+
+	pruned, err := v.walkGeneratedPrune(root, tagsValuesPkgs, requestedTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := filepath.Join(root, "pkg/orphaned/zz_generated.deepcopy.go")
+	if len(pruned) != 1 || pruned[0] != want {
+		t.Fatalf("pruned = %v, want [%s]", pruned, want)
+	}
+	if _, err := os.Stat(want); !os.IsNotExist(err) {
+		t.Errorf("%s still exists, want it removed", want)
+	}
+	if _, err := os.Stat(filepath.Join(root, "pkg/tagged/zz_generated.deepcopy.go")); err != nil {
+		t.Errorf("tagged package's zz_generated file was removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "pkg/untouched/zz_generated.defaulter.go")); err != nil {
+		t.Errorf("zz_generated.defaulter.go was removed even though defaulter-gen was never scanned: %v", err)
+	}
+}
+
+func TestWalkGeneratedPruneDryRun(t *testing.T) {
+	root, err := ioutil.TempDir("", "kazel-prune-dry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeZZFile(t, root, "pkg/orphaned", "zz_generated.deepcopy.go")
+
+	v := &Vendorer{cfg: &Config{K8sCodegenZZPrefixes: []string{"deepcopy"}}, dryRun: true}
+	tagsValuesPkgs := generatorTagsValuesPkgsMap{}
+	requestedTags := map[string]bool{"deepcopy-gen": true}
+
+	pruned, err := v.walkGeneratedPrune(root, tagsValuesPkgs, requestedTags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 {
+		t.Fatalf("pruned = %v, want 1 entry reported", pruned)
+	}
+	if _, err := os.Stat(filepath.Join(root, "pkg/orphaned/zz_generated.deepcopy.go")); err != nil {
+		t.Errorf("dry-run removed a file: %v", err)
+	}
+}
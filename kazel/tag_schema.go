@@ -0,0 +1,135 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// tagValueKind is the declared shape of a +k8s: tag's value, as configured
+// in K8sCodegenTagSchema.
+type tagValueKind string
+
+const (
+	// tagKindBool requires the value to be exactly "true" or "false".
+	tagKindBool tagValueKind = "bool"
+	// tagKindEnum requires the value to be one of EnumValues.
+	tagKindEnum tagValueKind = "enum"
+	// tagKindCSVEnum requires a comma-separated list whose entries are each
+	// one of EnumValues; this is the historical default behavior.
+	tagKindCSVEnum tagValueKind = "csv-enum"
+	// tagKindIdentifier requires the value to match a Go identifier.
+	tagKindIdentifier tagValueKind = "identifier"
+	// tagKindPath requires the value to resolve to an existing package
+	// directory under the walk root.
+	tagKindPath tagValueKind = "path"
+)
+
+var goIdentifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// tagSchema describes the expected value shape for a single tag.
+type tagSchema struct {
+	Kind       tagValueKind `yaml:"kind"`
+	EnumValues []string     `yaml:"enumValues"`
+}
+
+// tagValueError describes a single tag occurrence whose value didn't
+// validate against its configured tagSchema.
+type tagValueError struct {
+	File   string
+	Line   int
+	Tag    string
+	Value  string
+	Reason string
+}
+
+func (e tagValueError) Error() string {
+	return fmt.Sprintf("%s:%d: tag %q has invalid value %q: %s", e.File, e.Line, e.Tag, e.Value, e.Reason)
+}
+
+// tagValueErrors aggregates every tagValueError found while walking the
+// tree, so findGeneratorTags can surface them as a single error.
+type tagValueErrors []tagValueError
+
+func (e tagValueErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// validateTagValue checks value against the schema configured for tag (if
+// any; tags without a configured schema are accepted as-is for backwards
+// compatibility) and returns a non-empty reason if it's invalid.
+func validateTagValue(schemas map[string]tagSchema, root, tag, value string) string {
+	schema, configured := schemas[tag]
+	if !configured {
+		return ""
+	}
+	switch schema.Kind {
+	case tagKindBool:
+		if value != "true" && value != "false" {
+			return "expected \"true\" or \"false\""
+		}
+	case tagKindEnum:
+		if !stringInSlice(value, schema.EnumValues) {
+			return fmt.Sprintf("expected one of %v", schema.EnumValues)
+		}
+	case tagKindCSVEnum:
+		for _, v := range strings.Split(value, ",") {
+			if !stringInSlice(v, schema.EnumValues) {
+				return fmt.Sprintf("csv entry %q not one of %v", v, schema.EnumValues)
+			}
+		}
+	case tagKindIdentifier:
+		if !goIdentifierRe.MatchString(value) {
+			return "expected a valid Go identifier"
+		}
+	case tagKindPath:
+		if _, err := os.Stat(filepath.Join(root, value)); err != nil {
+			return fmt.Sprintf("package %q does not exist under root", value)
+		}
+	}
+	return ""
+}
+
+// flattenedSchemas converts the configured tag schemas into a Starlark-friendly
+// dictionary shape for inclusion in the emitted bzl file.
+func flattenedSchemas(schemas map[string]tagSchema) map[string]map[string]interface{} {
+	out := make(map[string]map[string]interface{})
+	for tag, schema := range schemas {
+		out[tag] = map[string]interface{}{
+			"kind":        string(schema.Kind),
+			"enum_values": schema.EnumValues,
+		}
+	}
+	return out
+}
+
+func stringInSlice(s string, slice []string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateTagValue(t *testing.T) {
+	root, err := ioutil.TempDir("", "kazel-schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "pkg", "exists"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	schemas := map[string]tagSchema{
+		"deepcopy-gen":   {Kind: tagKindBool},
+		"client-gen":     {Kind: tagKindEnum, EnumValues: []string{"register", "package"}},
+		"conversion-gen": {Kind: tagKindCSVEnum, EnumValues: []string{"internal", "external"}},
+		"group-name":     {Kind: tagKindIdentifier},
+		"input-base":     {Kind: tagKindPath},
+	}
+
+	cases := []struct {
+		name    string
+		tag     string
+		value   string
+		wantErr bool
+	}{
+		{"bool true", "deepcopy-gen", "true", false},
+		{"bool false", "deepcopy-gen", "false", false},
+		{"bool garbage", "deepcopy-gen", "yes", true},
+		{"enum valid", "client-gen", "register", false},
+		{"enum invalid", "client-gen", "bogus", true},
+		{"csv-enum all valid", "conversion-gen", "internal,external", false},
+		{"csv-enum one invalid", "conversion-gen", "internal,bogus", true},
+		{"identifier valid", "group-name", "FooBar", false},
+		{"identifier invalid", "group-name", "3foo", true},
+		{"path exists", "input-base", "pkg/exists", false},
+		{"path missing", "input-base", "pkg/missing", true},
+		{"unconfigured tag accepted as-is", "no-schema-tag", "anything goes", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reason := validateTagValue(schemas, root, c.tag, c.value)
+			if c.wantErr && reason == "" {
+				t.Errorf("validateTagValue(%q, %q) = \"\", want a non-empty reason", c.tag, c.value)
+			}
+			if !c.wantErr && reason != "" {
+				t.Errorf("validateTagValue(%q, %q) = %q, want \"\"", c.tag, c.value, reason)
+			}
+		})
+	}
+}